@@ -1,19 +1,283 @@
 package main
 
 import (
+    "bytes"
+    "crypto/sha256"
+    "encoding/json"
+    "flag"
     "fmt"
+    "io"
     "os"
+    "path/filepath"
+    "strings"
 
+    "golang.org/x/mod/module"
     "golang.org/x/mod/sumdb/dirhash"
+    modzip "golang.org/x/mod/zip"
 )
 
 func main() {
-    if len(os.Args) != 2 {
-        fmt.Fprintf(os.Stderr, "Usage: %s <zip-file>\n", os.Args[0])
+    args := os.Args[1:]
+    if len(args) > 0 {
+        switch args[0] {
+        case "ziphash":
+            runZiphash(args[1:])
+            return
+        case "zip":
+            runZip(args[1:])
+            return
+        }
+    }
+    runHash(args)
+}
+
+// hashResult is the -json output shape: one record covering every hash the
+// go toolchain stores alongside a cached module.
+type hashResult struct {
+    Path    string `json:"path"`
+    Size    int64  `json:"size,omitempty"`
+    H1      string `json:"h1"`
+    SHA256  string `json:"sha256,omitempty"`
+    GomodH1 string `json:"gomod_h1,omitempty"`
+}
+
+// runHash implements the original one-shot hashing behavior: hash a zip (or,
+// with -dir, an unpacked module directory), optionally verify the result
+// against an expected h1: hash, and optionally report the raw sha256 of a
+// zip and the HashGoMod of a go.mod file alongside it.
+func runHash(args []string) {
+    fs := flag.NewFlagSet("hash", flag.ExitOnError)
+    dirMode := fs.Bool("dir", false, "hash an unpacked module directory instead of a zip")
+    module := fs.String("module", "", "module@version prefix to hash under (required with -dir)")
+    verify := fs.String("verify", "", "expected h1: hash to verify against")
+    gomod := fs.String("gomod", "", "also report the go.mod hash of this go.mod file")
+    sha256Out := fs.Bool("sha256", false, "also report the raw sha256 of the zip bytes")
+    jsonOut := fs.Bool("json", false, "emit a JSON record instead of bare h1:/sha256:/gomod_h1: lines")
+    fs.Parse(args)
+
+    rest := fs.Args()
+    if len(rest) < 1 || len(rest) > 2 {
+        fmt.Fprintf(os.Stderr, "Usage: %s [-dir -module path@version] [-verify h1:...] [-gomod file] [-sha256] [-json] <zip-file|dir> [expected-h1]\n", os.Args[0])
+        os.Exit(1)
+    }
+
+    path := rest[0]
+    expected := *verify
+    if len(rest) == 2 {
+        if expected != "" {
+            fmt.Fprintf(os.Stderr, "Error: expected hash given both as -verify and as a second argument\n")
+            os.Exit(1)
+        }
+        expected = rest[1]
+    }
+
+    result := hashResult{Path: path}
+    var err error
+    if *dirMode {
+        if *module == "" {
+            fmt.Fprintf(os.Stderr, "Error: -module path@version is required with -dir\n")
+            os.Exit(1)
+        }
+        result.H1, err = dirhash.HashDir(path, *module, dirhash.DefaultHash)
+    } else {
+        result.H1, err = dirhash.HashZip(path, dirhash.DefaultHash)
+        if err == nil && *sha256Out {
+            result.Size, result.SHA256, err = sha256File(path)
+        }
+    }
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+        os.Exit(1)
+    }
+
+    if *gomod != "" {
+        result.GomodH1, err = hashGoMod(*gomod)
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+            os.Exit(1)
+        }
+    }
+
+    if *jsonOut {
+        enc := json.NewEncoder(os.Stdout)
+        enc.SetIndent("", "  ")
+        if err := enc.Encode(result); err != nil {
+            fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+            os.Exit(1)
+        }
+    } else {
+        fmt.Println(result.H1)
+        if result.SHA256 != "" {
+            fmt.Printf("sha256:%s\n", result.SHA256)
+        }
+        if result.GomodH1 != "" {
+            fmt.Println(result.GomodH1)
+        }
+    }
+
+    if expected != "" && result.H1 != expected {
+        fmt.Fprintf(os.Stderr, "%s: zip has been modified or is not the expected version (expected %s, got %s)\n", path, expected, result.H1)
+        os.Exit(1)
+    }
+}
+
+// hashGoMod computes the same dirhash the go command records for a go.mod
+// file: a Hash1 over a single-entry file list, as
+// cmd/go/internal/modfetch/fetch.go's goModSum does. dirhash has no
+// HashGoMod helper, so this reproduces it by hand. The entry is always
+// named "go.mod", never prefixed by a module path or version, regardless
+// of what module the file belongs to.
+func hashGoMod(path string) (string, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return "", err
+    }
+    return dirhash.Hash1([]string{"go.mod"}, func(string) (io.ReadCloser, error) {
+        return io.NopCloser(bytes.NewReader(data)), nil
+    })
+}
+
+// sha256File returns a file's size and the raw (non-dirhash) hex-encoded
+// sha256 of its bytes, for downstream tooling that wants the plain digest
+// the go command also records for each cached zip.
+func sha256File(path string) (int64, string, error) {
+    f, err := os.Open(path)
+    if err != nil {
+        return 0, "", err
+    }
+    defer f.Close()
+
+    h := sha256.New()
+    size, err := io.Copy(h, f)
+    if err != nil {
+        return 0, "", err
+    }
+    return size, fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// runZiphash walks a GOMODCACHE/cache/download tree and recomputes the
+// .ziphash sidecar for every .zip that is missing or has a stale one, mirroring
+// the recovery behavior the go command performs when a ziphash file has been
+// deleted or lost after a crash.
+func runZiphash(args []string) {
+    fs := flag.NewFlagSet("ziphash", flag.ExitOnError)
+    check := fs.Bool("check", false, "report missing or mismatched .ziphash files instead of writing them")
+    fs.Parse(args)
+
+    if fs.NArg() != 1 {
+        fmt.Fprintf(os.Stderr, "Usage: %s ziphash [-check] <GOMODCACHE/cache/download>\n", os.Args[0])
+        os.Exit(1)
+    }
+    root := fs.Arg(0)
+
+    stale := false
+    err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+        if err != nil {
+            return err
+        }
+        if info.IsDir() || !strings.HasSuffix(path, ".zip") {
+            return nil
+        }
+        if _, err := os.Stat(path + ".partial"); err == nil {
+            fmt.Fprintf(os.Stderr, "%s: skipping, download in progress (.partial present)\n", path)
+            return nil
+        }
+
+        ziphashPath := strings.TrimSuffix(path, ".zip") + ".ziphash"
+        want, err := dirhash.HashZip(path, dirhash.DefaultHash)
+        if err != nil {
+            return fmt.Errorf("hashing %s: %w", path, err)
+        }
+
+        have, err := os.ReadFile(ziphashPath)
+        switch {
+        case err != nil && !os.IsNotExist(err):
+            return fmt.Errorf("reading %s: %w", ziphashPath, err)
+        case err != nil:
+            fmt.Printf("%s: missing, want %s\n", ziphashPath, want)
+            stale = true
+        case strings.TrimSpace(string(have)) != want:
+            fmt.Printf("%s: mismatch, have %s, want %s\n", ziphashPath, strings.TrimSpace(string(have)), want)
+            stale = true
+        default:
+            return nil
+        }
+
+        if *check {
+            return nil
+        }
+        return writeZiphash(ziphashPath, want)
+    })
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+        os.Exit(1)
+    }
+    if *check && stale {
+        os.Exit(1)
+    }
+}
+
+// writeZiphash writes hash to path atomically, so a crash or a concurrent
+// reader never observes a truncated .ziphash file.
+func writeZiphash(path, hash string) error {
+    tmp := path + ".tmp"
+    if err := os.WriteFile(tmp, []byte(hash), 0o644); err != nil {
+        return err
+    }
+    return os.Rename(tmp, path)
+}
+
+// runZip builds a canonical module zip from a source directory (or, with
+// -vcs, a VCS checkout) using golang.org/x/mod/zip, then hashes the result
+// the same way the go command would before publishing or mirroring it.
+func runZip(args []string) {
+    fs := flag.NewFlagSet("zip", flag.ExitOnError)
+    vcs := fs.Bool("vcs", false, "build the zip from a VCS checkout (path is the repo root) instead of a plain directory")
+    rev := fs.String("rev", "HEAD", "revision to check out when -vcs is set")
+    out := fs.String("o", "", "write the created zip here instead of a temporary file")
+    fs.Parse(args)
+
+    if fs.NArg() != 2 {
+        fmt.Fprintf(os.Stderr, "Usage: %s zip [-vcs] [-rev rev] [-o file] <dir> <module@version>\n", os.Args[0])
+        os.Exit(1)
+    }
+    dir := fs.Arg(0)
+    m, err := parseModuleVersion(fs.Arg(1))
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+        os.Exit(1)
+    }
+
+    zipPath := *out
+    var f *os.File
+    if zipPath == "" {
+        f, err = os.CreateTemp("", "dirhash-helper-*.zip")
+        if err == nil {
+            zipPath = f.Name()
+            defer os.Remove(zipPath)
+        }
+    } else {
+        f, err = os.Create(zipPath)
+    }
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+        os.Exit(1)
+    }
+
+    if *vcs {
+        err = modzip.CreateFromVCS(f, m, dir, *rev, "")
+    } else {
+        err = modzip.CreateFromDir(f, m, dir)
+    }
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+        os.Exit(1)
+    }
+    if err := f.Close(); err != nil {
+        fmt.Fprintf(os.Stderr, "Error: %v\n", err)
         os.Exit(1)
     }
 
-    zipPath := os.Args[1]
     hash, err := dirhash.HashZip(zipPath, dirhash.DefaultHash)
     if err != nil {
         fmt.Fprintf(os.Stderr, "Error: %v\n", err)
@@ -21,4 +285,17 @@ func main() {
     }
 
     fmt.Println(hash)
+    if *out != "" {
+        fmt.Fprintf(os.Stderr, "wrote module zip to %s\n", *out)
+    }
+}
+
+// parseModuleVersion splits a "path@version" argument into a module.Version,
+// the form dirhash and zip.Create* expect.
+func parseModuleVersion(s string) (module.Version, error) {
+    path, version, ok := strings.Cut(s, "@")
+    if !ok || path == "" || version == "" {
+        return module.Version{}, fmt.Errorf("%q is not in path@version form", s)
+    }
+    return module.Version{Path: path, Version: version}, nil
 }